@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// For build-time overriding
+var systemConfigFileName = "/etc/rumenu/config.toml"
+
+func findConfigDir() string {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		configDir = os.Getenv("HOME") + "/.config"
+	}
+	configDir += "/rumenu"
+	return configDir
+}
+
+// flagSources holds where each flag was set from.
+var flagSources = make(map[string][]string)
+
+// setFlag sets a flag from a config source. Unlike flag.Set, it doesn't mark
+// the flag as set on the command line.
+func setFlag(name, value, source string) error {
+	f := flag.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("unknown setting %q", name)
+	}
+	if err := f.Value.Set(value); err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	if sources := flagSources[name]; !slices.Contains(sources, source) {
+		flagSources[name] = append(sources, source)
+	}
+	return nil
+}
+
+// parseFlags parses the command line, recording which flags it sets.
+func parseFlags() {
+	flag.Parse()
+	flag.Visit(func(f *flag.Flag) {
+		flagSources[f.Name] = append(flagSources[f.Name], "command line")
+	})
+}
+
+// dumpConfig prints the value of every flag, along with where it was set.
+func dumpConfig() error {
+	w := bufio.NewWriter(os.Stdout)
+	flag.VisitAll(func(f *flag.Flag) {
+		source := "default"
+		if sources := flagSources[f.Name]; sources != nil {
+			source = strings.Join(sources, ", ")
+		}
+		fmt.Fprintf(w, "%s = %q  # %s\n", f.Name, f.Value.String(), source)
+	})
+	return w.Flush()
+}
+
+// loadConfig sets flags from the system config, then the user config, then
+// the environment, so that each overrides the one before. Flags given on the
+// command line are parsed afterwards and override all of them.
+func loadConfig() error {
+	for _, fileName := range []string{systemConfigFileName, findConfigDir() + "/config.toml"} {
+		if err := readConfig(fileName); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		name := "RUMENU_" + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if v, ok := os.LookupEnv(name); ok && err == nil {
+			if setErr := setFlag(f.Name, v, name); setErr != nil {
+				err = fmt.Errorf("%s: %s", name, setErr)
+			}
+		}
+	})
+	return err
+}
+
+// readConfig sets flags from a config file. The config file is a subset of
+// TOML: each line is a flag name, an equals sign, and a value, which is a
+// string, a boolean, a number, or an array of strings for flags that can be
+// repeated.
+func readConfig(fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	lineNum := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d invalid syntax", fileName, lineNum)
+		}
+		name = strings.TrimSpace(name)
+		values, err := parseConfigValue(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s:%d invalid syntax: %s", fileName, lineNum, err)
+		}
+		source := fmt.Sprintf("%s:%d", fileName, lineNum)
+		for _, v := range values {
+			if err := setFlag(name, v, source); err != nil {
+				return fmt.Errorf("%s %s", source, err)
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func parseConfigValue(value string) ([]string, error) {
+	list, ok := strings.CutPrefix(value, "[")
+	if !ok {
+		v, rest, err := parseConfigString(value)
+		if err != nil {
+			return nil, err
+		}
+		if rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, fmt.Errorf("unexpected %q", rest)
+		}
+		return []string{v}, nil
+	}
+	var values []string
+	rest := strings.TrimSpace(list)
+	for !strings.HasPrefix(rest, "]") {
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return nil, errors.New("expected a string")
+		}
+		v, _ := strconv.Unquote(quoted)
+		values = append(values, v)
+		rest = strings.TrimSpace(rest[len(quoted):])
+		if r, ok := strings.CutPrefix(rest, ","); ok {
+			rest = strings.TrimSpace(r)
+		} else if !strings.HasPrefix(rest, "]") {
+			return nil, errors.New("expected a comma or ]")
+		}
+	}
+	if rest = strings.TrimSpace(rest[1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+		return nil, fmt.Errorf("unexpected %q", rest)
+	}
+	return values, nil
+}
+
+// parseConfigString parses a single value, which is either quoted or runs to
+// the end of the line or a comment.
+func parseConfigString(value string) (v, rest string, err error) {
+	if !strings.HasPrefix(value, `"`) {
+		v, _, _ := strings.Cut(value, "#")
+		return strings.TrimSpace(v), "", nil
+	}
+	quoted, err := strconv.QuotedPrefix(value)
+	if err != nil {
+		return "", "", errors.New("unterminated string")
+	}
+	v, _ = strconv.Unquote(quoted)
+	return v, strings.TrimSpace(value[len(quoted):]), nil
+}
+
+// readEnvOverlay returns the environment variables to set for prog from the
+// -env-file. Each line of the file is a program name followed by
+// KEY=VALUE pairs, separated by spaces.
+func readEnvOverlay(fileName, prog string) ([]string, error) {
+	f, err := os.Open(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var env []string
+	lineNum := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNum++
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 || strings.HasPrefix(words[0], "#") || words[0] != prog {
+			continue
+		}
+		for _, w := range words[1:] {
+			if k, _, ok := strings.Cut(w, "="); !ok || k == "" {
+				return nil, fmt.Errorf("%s:%d expected KEY=VALUE, got %q", fileName, lineNum, w)
+			}
+			env = append(env, w)
+		}
+	}
+	return env, scanner.Err()
+}
+
+// readSandbox returns the sandbox command for prog from the
+// -sandbox-profiles file, or an empty string if it has none. Each line of
+// the file is a program name followed by the command to run it under.
+func readSandbox(fileName, prog string) (string, error) {
+	f, err := os.Open(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	lineNum := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNum++
+		name, sandbox, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if name == "" || strings.HasPrefix(name, "#") || name != prog {
+			continue
+		}
+		if sandbox = strings.TrimSpace(sandbox); sandbox == "" {
+			return "", fmt.Errorf("%s:%d missing sandbox command for %s", fileName, lineNum, prog)
+		}
+		return sandbox, nil
+	}
+	return "", scanner.Err()
+}
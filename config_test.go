@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestParseConfigValue(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{`"newest"`, []string{"newest"}, false},
+		{`newest`, []string{"newest"}, false},
+		{`true`, []string{"true"}, false},
+		{`"a \"quoted\" value"`, []string{`a "quoted" value`}, false},
+		{`"# not a comment"`, []string{"# not a comment"}, false},
+		{`""`, []string{""}, false},
+		{`"newest"  # comment`, []string{"newest"}, false},
+		{`newest # comment`, []string{"newest"}, false},
+		{`"newest" extra`, nil, true},
+		{`"unterminated`, nil, true},
+		{`[]`, nil, false},
+		{`[ ]  # comment`, nil, false},
+		{`["a=b", "c=d"]`, []string{"a=b", "c=d"}, false},
+		{`["a=b", "c=d",]`, []string{"a=b", "c=d"}, false},
+		{`["a=b" "c=d"]`, nil, true},
+		{`["a=b", c]`, nil, true},
+		{`["unterminated]`, nil, true},
+		{`["a=b"`, nil, true},
+		{`["a=b"] extra`, nil, true},
+	}
+	for _, test := range tests {
+		got, err := parseConfigValue(test.value)
+		if (err != nil) != test.wantErr || !slices.Equal(got, test.want) {
+			t.Errorf("parseConfigValue(%s) = %q, %v, want %q, error %t", test.value, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig := func(fileName, config string) {
+		if err := os.WriteFile(fileName, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldSystemConfig := systemConfigFileName
+	systemConfigFileName = dir + "/system.toml"
+	t.Cleanup(func() { systemConfigFileName = oldSystemConfig })
+	writeConfig(systemConfigFileName, `
+launcher = "system"
+preselect-arg = "system"
+clipboard-cmd = "system"
+recent-header = "system"
+`)
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	if err := os.Mkdir(dir+"/rumenu", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeConfig(dir+"/rumenu/config.toml", `
+preselect-arg = "user"
+clipboard-cmd = "user"
+recent-header = "user"
+`)
+	t.Setenv("RUMENU_CLIPBOARD_CMD", "env")
+	t.Setenv("RUMENU_RECENT_HEADER", "env")
+	oldArgs := os.Args
+	os.Args = []string{"rumenu", "-recent-header=flag"}
+	t.Cleanup(func() { os.Args = oldArgs })
+	// Restored afterwards.
+	for _, name := range []string{"launcher", "preselect-arg", "clipboard-cmd", "recent-header"} {
+		setTestFlag(t, name, "default")
+	}
+
+	if err := loadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	parseFlags()
+	for _, want := range []struct{ name, value string }{
+		{"launcher", "system"},
+		{"preselect-arg", "user"},
+		{"clipboard-cmd", "env"},
+		{"recent-header", "flag"},
+	} {
+		if got := flag.Lookup(want.name).Value.String(); got != want.value {
+			t.Errorf("-%s = %q, want %q", want.name, got, want.value)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+var (
+	dbusSignal = flag.String("dbus-signal", "", "emit a D-Bus signal named `INTERFACE.MEMBER` on the session bus for each launch")
+	dbusPath   = flag.String("dbus-path", "/org/rumenu/Launcher", "object `PATH` the -dbus-signal is sent from")
+)
+
+// emitLaunch sends the -dbus-signal for a launch, with the program and the
+// full command as its arguments. There's no D-Bus client in the standard
+// library, so this runs dbus-send. Failures are only reported as warnings,
+// since the launch has already happened.
+func emitLaunch(ctx context.Context, prog, command string) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "dbus-send", "--session", "--type=signal", *dbusPath, *dbusSignal,
+		"string:"+prog, "string:"+command)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			err = fmt.Errorf("%s: %s", err, msg)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: dbus-send: %s\n", err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// desktopMarker is set in the desktop files written by exportDesktop, so
+// that files written by anything else are never touched.
+const desktopMarker = "X-Rumenu-Rank"
+
+// exportDesktop writes a desktop file for each of the n most launched
+// programs to dir, and removes the ones it wrote before for programs that
+// are no longer among them.
+func exportDesktop(dir string, n int) error {
+	freq, err := readFreq(countsFileName)
+	if err != nil {
+		return err
+	}
+	progs := make([]string, 0, len(freq))
+	for name := range freq {
+		if !strings.Contains(name, "/") {
+			progs = append(progs, name)
+		}
+	}
+	slices.SortFunc(progs, byValue(freq))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	written := make(map[string]bool)
+	for _, prog := range progs {
+		if len(written) == n {
+			break
+		}
+		path, err := exec.LookPath(prog)
+		if err != nil {
+			continue
+		}
+		fileName := filepath.Join(dir, "rumenu-"+prog+".desktop")
+		if ours, err := isExportedDesktop(fileName); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		} else if err == nil && !ours {
+			fmt.Fprintf(os.Stderr, "Warning: not overwriting %s, which wasn't written by -export-desktop\n", fileName)
+			continue
+		}
+		contents := fmt.Sprintf("[Desktop Entry]\nType=Application\nName=%s\nExec=%s\n%s=%d\nX-Rumenu-Launches=%d\n",
+			prog, desktopQuote(path), desktopMarker, len(written)+1, freq[prog])
+		if err := os.WriteFile(fileName, []byte(contents), 0644); err != nil {
+			return err
+		}
+		written[fileName] = true
+	}
+
+	stale, err := filepath.Glob(filepath.Join(dir, "rumenu-*.desktop"))
+	if err != nil {
+		return err
+	}
+	for _, fileName := range stale {
+		if written[fileName] {
+			continue
+		}
+		if ours, err := isExportedDesktop(fileName); err == nil && ours {
+			if err := os.Remove(fileName); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Printf("Exported %d programs to %s\n", len(written), dir)
+	return nil
+}
+
+// isExportedDesktop reports whether the desktop file was written by
+// exportDesktop.
+func isExportedDesktop(fileName string) (bool, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), desktopMarker+"=") {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// desktopQuote quotes an argument for the Exec key of a desktop file.
+func desktopQuote(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	if !strings.ContainsAny(arg, " \t\n\"'\\><~|&;$*?#()`") {
+		return arg
+	}
+	r := strings.NewReplacer(`"`, `\"`, "`", "\\`", "$", `\$`, `\`, `\\`)
+	// The desktop file format also unescapes backslashes once when reading
+	// a string value, before the Exec quoting is applied.
+	return strings.ReplaceAll(`"`+r.Replace(arg)+`"`, `\`, `\\`)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	launcher        = flag.String("launcher", bemenu, "show the menu with `COMMAND`, which is split into words")
+	trailingNewline = flag.Bool("trailing-newline", true, "end the last menu entry with a newline; turn off for launchers that show it as an extra empty entry")
+	preselect       = flag.Bool("preselect", false, "start with the top-ranked program selected, even if -top or -commands entries come before it")
+	preselectArg    = flag.String("preselect-arg", "-I", "the launcher's `FLAG` for the index of the initially selected entry, such as -selected-row for rofi")
+	launcherInput   = flag.String("launcher-input", "stdin", "how the launcher reads the menu: stdin, or file to pass the name of a file holding the menu as its last argument")
+)
+
+// A menuInput gives the menu to the launcher.
+type menuInput interface {
+	// attach sets up cmd to read menu. The returned function must be
+	// called once cmd has exited.
+	attach(cmd *exec.Cmd, menu string) (cleanup func(), err error)
+}
+
+var menuInputs = map[string]menuInput{
+	"stdin": stdinInput{},
+	"file":  fileInput{},
+}
+
+// stdinInput writes the menu to the launcher's stdin, like bemenu and dmenu
+// expect.
+type stdinInput struct{}
+
+func (stdinInput) attach(cmd *exec.Cmd, menu string) (func(), error) {
+	cmd.Stdin = strings.NewReader(menu)
+	return func() {}, nil
+}
+
+// fileInput writes the menu to a temporary file, and passes its name to the
+// launcher.
+type fileInput struct{}
+
+func (fileInput) attach(cmd *exec.Cmd, menu string) (cleanup func(), err error) {
+	f, err := os.CreateTemp("", "rumenu")
+	if err != nil {
+		return nil, err
+	}
+	cleanup = func() { os.Remove(f.Name()) }
+	if _, err := f.WriteString(menu); err != nil {
+		f.Close()
+		cleanup()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return nil, err
+	}
+	cmd.Args = append(cmd.Args, f.Name())
+	return cleanup, nil
+}
+
+// menuText joins the lines of the menu for the launcher, ending the last one
+// with a newline if trailingNewline is set. An empty menu is always empty.
+func menuText(lines []string, trailingNewline bool) string {
+	text := strings.Join(lines, "\n")
+	if len(lines) > 0 && trailingNewline {
+		text += "\n"
+	}
+	return text
+}
+
+// showMenu shows lines in the launcher, and returns the selected or typed
+// line.
+func showMenu(ctx context.Context, lines []string, args ...string) (string, error) {
+	input, ok := menuInputs[*launcherInput]
+	if !ok {
+		return "", fmt.Errorf("invalid -launcher-input %q", *launcherInput)
+	}
+	words := strings.Fields(*launcher)
+	if len(words) == 0 {
+		return "", errors.New("no launcher")
+	}
+	name := filepath.Base(words[0])
+	cmd := exec.CommandContext(ctx, words[0], append(words[1:], args...)...)
+	cleanup, err := input.attach(cmd, menuText(lines, *trailingNewline))
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", name, err)
+	}
+	defer cleanup()
+	choice, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return string(bytes.TrimSuffix(choice, []byte("\n"))), nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestMenuText(t *testing.T) {
+	tests := []struct {
+		lines           []string
+		trailingNewline bool
+		want            string
+	}{
+		{nil, false, ""},
+		{nil, true, ""},
+		{[]string{"foot"}, false, "foot"},
+		{[]string{"foot"}, true, "foot\n"},
+		{[]string{"foot", "firefox"}, false, "foot\nfirefox"},
+		{[]string{"foot", "firefox"}, true, "foot\nfirefox\n"},
+		{[]string{""}, true, "\n"},
+	}
+	for _, test := range tests {
+		if got := menuText(test.lines, test.trailingNewline); got != test.want {
+			t.Errorf("menuText(%q, %t) = %q, want %q", test.lines, test.trailingNewline, got, test.want)
+		}
+	}
+}
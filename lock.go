@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+var lockTimeout = flag.Duration("lock-timeout", 2*time.Second, "how long to wait for other instances to finish saving counts before giving up on saving them")
+
+// lockData takes an exclusive lock on the data directory, so that only one
+// instance at a time reads and writes the counts. It waits up to timeout for
+// other instances to release it. The returned function releases the lock.
+func lockData(timeout time.Duration) (unlock func(), err error) {
+	f, err := os.OpenFile(dataDir+"/lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("lock: %s", err)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			// Closing the file releases the lock.
+			return func() { f.Close() }, nil
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			f.Close()
+			return nil, fmt.Errorf("lock %s: %s", f.Name(), err)
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("lock %s: timed out after %s", f.Name(), timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
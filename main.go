@@ -1,28 +1,281 @@
+// Bemenu-frequently-used is like bemenu-run, but programs are sorted by how
+// often they have been launched.
+//
+// Launch counts are stored in $XDG_DATA_HOME/rumenu/counts, one program per
+// line followed by a tab and the count.
+//
+// Programs launched equally often are sorted by name. With -tie-break=path
+// they're sorted by where their directory comes in PATH first, so that
+// programs from a personal bin directory early in PATH come before system
+// ones, and only by name within the same directory.
+//
+// With -rank-dirs, only programs from the listed directories, separated by
+// colons like PATH, are sorted by how often they've been launched. They come
+// first, followed by the programs from every other directory, sorted as if
+// they had never been launched. This only applies to the default sort mode;
+// -sort=newest orders every program by when it was installed.
+//
+// With -source TAG, each launch is counted both for the program and for the
+// program under TAG, so that menus opened from different places can learn
+// independently. Per-source counts live in the same counts file, under the
+// name TAG/PROGRAM; since program names never contain a slash they can't
+// collide with ordinary entries. The menu is ranked by the counts for TAG
+// alone, unless -combined is given, in which case it's ranked by the launches
+// from all sources together.
+//
+// Failing to save the counts doesn't undo a launch, so it's only reported as
+// a warning, unless -strict is given.
+//
+// The time each program was last launched is stored in the same format in
+// $XDG_DATA_HOME/rumenu/times, as seconds since the Unix epoch. It can be
+// changed with -touch, which sets it to the current time, and -untouch, which
+// removes it.
+//
+// With -sharded, each of these files is instead split into a directory of
+// the same name with a .d suffix, holding a file for each first byte of the
+// names in it, so that saving a launch only rewrites a small part of a large
+// history. An existing file is split up the first time it's saved with
+// -sharded, and stays split up, even when saved without it.
+//
+// Only one instance at a time saves counts, holding a lock on
+// $XDG_DATA_HOME/rumenu/lock. An instance waits up to -lock-timeout (2s by
+// default) for the lock, then gives up on saving its counts with a warning;
+// the launch itself never waits for the lock.
+//
+// -selftest checks that the data directory works for all of this, by saving
+// and reading back counts and taking the lock in a scratch directory inside
+// it, which is removed afterwards. It reports on each check, and exits with a
+// non-zero status if any failed.
+//
+// Commands run with arguments are counted for the program they run, and the
+// full command line is also counted in $XDG_DATA_HOME/rumenu/commands. With
+// -commands N, the N most often run command lines are shown as menu entries
+// of their own.
+//
+// With -track-time, the total number of seconds spent in each program is
+// kept in $XDG_DATA_HOME/rumenu/durations. Only programs that run in the
+// foreground are timed, so time after -detach-after isn't counted.
+//
+// Each time one of these files is replaced, the previous version is kept next
+// to it with a .bak suffix. Only one backup is kept. If a file is found empty
+// or corrupted, for example after an interrupted write, it's read from the
+// backup instead.
+//
+// Entries added with -top are shown above every program, in the order given,
+// regardless of the sort mode. Selecting one runs its command, and isn't
+// counted.
+//
+// A -top command can include {clipboard}, which is replaced by the contents
+// of the clipboard when the entry is selected, as printed by -clipboard-cmd
+// (wl-paste -n by default; use "xclip -o -selection clipboard" on X11). For
+// example, -top "Open copied link=firefox {clipboard}". The contents are
+// quoted, so they're passed as a single argument, except with -no-shell,
+// where they're split into words like the rest of the command. If the
+// clipboard is empty, nothing is run, with only a warning.
+//
+// With -recent N, the N programs launched most recently are shown right
+// below those entries, under the -recent-header line, and aren't repeated
+// further down. The rest of the menu is sorted as usual.
+//
+// An entry with the same text as a program or command line shown further
+// down is only listed once. Which one it runs is decided by -priority, a
+// comma-separated order of the three sources, "top,commands,path" by
+// default, so normally a -top entry takes the place of a program of the same
+// name.
+//
+// With -filter, the menu is passed through a shell command before it's
+// shown, for example to shorten or decorate the entries. The command gets
+// the entries on its standard input, one per line, and must print exactly
+// one line for each, in the same order; selecting a line runs the entry it
+// was printed for, so the filter only changes how entries look.
+//
+// Whether a launch is counted depends on how it went:
+//
+//   - Programs from PATH that exit successfully are counted, unless they exit
+//     sooner than -min-runtime.
+//   - Programs from PATH that fail are counted, unless -count=success is
+//     given.
+//   - Programs still running after -detach-after are counted as successful.
+//   - Programs from PATH whose launch is rejected by -pre-launch aren't
+//     counted, unless -count-vetoed is given, in which case the selection
+//     is counted as if the program had been launched successfully (without
+//     adding to its time spent), and rumenu still exits with an error.
+//   - Entries from -top, typed commands that aren't on PATH, and cancelled
+//     menus are never counted.
+//
+// Counts are only written if the launch is counted, so a launch that isn't
+// counted leaves both files untouched.
+//
+// The -pre-launch hook is run with /bin/sh before anything is launched, and
+// the launch waits for it to finish. It gets the command about to be run in
+// $RUMENU_COMMAND, and the program it runs, if it's on PATH, in
+// $RUMENU_PROGRAM. If the hook fails, nothing is launched. If it prints
+// anything, that's run instead of the command, which lets it wrap the launch
+// in something like swaymsg exec.
+//
+// With -dbus-signal, a D-Bus signal is sent on the session bus each time
+// something is launched, for status bars and the like to pick up. It's sent
+// from the -dbus-path object, with two string arguments: the program, or an
+// empty string if the launch isn't of a program on PATH, and the full
+// command. It's sent with dbus-send once the program has started, and
+// failing to send it doesn't affect the launch.
+//
+// The selection is normally run by $SHELL, which may read startup files, and
+// can run anything typed. -safe is the recommended option for locking this
+// down: it runs programs directly without a shell (like -no-shell, which
+// splits the selection into words without any quoting), refuses to run
+// anything that isn't a program on PATH, including -top entries and typed
+// commands, and gives programs only the environment variables needed to
+// reach the desktop session.
+//
+// Programs listed in the -env-file get the variables given there added to
+// their environment, overriding any of the same name. This is applied last,
+// so the variables are set even with -safe.
+//
+// With -capture, the standard output and error of the launched program are
+// appended to a file instead of going wherever rumenu's own do, which helps
+// to debug a program that fails when launched from the menu. If the file
+// given is a directory, each launch gets a new file in it named after the
+// program and the time, like firefox-20240131-093000.log. Programs that need
+// a terminal won't work with -capture, since their output no longer goes to
+// one.
+//
+// With -sandbox, everything launched is run under a sandbox command, for
+// example -sandbox=firejail runs "firejail $SHELL -c firefox" for firefox,
+// or "firejail firefox" with -no-shell. The shell runs inside the sandbox,
+// so anything else on the command line is confined too. Programs can also
+// have a sandbox of their own, used instead of -sandbox, in the
+// -sandbox-profiles file, $XDG_CONFIG_HOME/rumenu/sandbox by default. Each
+// line of it is a program name, a space, and the command to run it under:
+//
+//	# Comments start with a hash.
+//	firefox firejail --profile=firefox
+//	zathura bwrap --ro-bind / / --dev /dev --unshare-net
+//
+// If the sandbox command isn't installed, nothing is launched, rather than
+// running the program unconfined. The -pre-launch hook sees the command with
+// the sandbox included.
+//
+// Anything typed that isn't in the menu is run as a shell command, except
+// for aliases given with -alias, and file names with an extension given to
+// -open, which are opened with the corresponding command instead. Aliases
+// only apply when there's no menu entry or program of the same name, and
+// may be followed by arguments, so with -alias ff=firefox, typing
+// "ff example.com" runs "firefox example.com" and counts a launch of
+// firefox.
+//
+// Every flag can also be set in a config file, or in the environment as
+// RUMENU_ followed by the flag name in upper case with dashes replaced by
+// underscores, for example RUMENU_SHUFFLE_TIES=true. Settings are applied in
+// this order, each overriding the ones before:
+//
+//  1. the system config, /etc/rumenu/config.toml
+//  2. the user config, $XDG_CONFIG_HOME/rumenu/config.toml
+//  3. the environment
+//  4. flags
+//
+// Flags that can be repeated, like -top, accumulate across all of them
+// instead. Config files that don't exist are skipped. Each line of a config
+// file sets a flag by name:
+//
+//	# Comments start with a hash.
+//	sort = "newest"
+//	shuffle-ties = true
+//	top = ["Settings=xdg-open ~/.config/rumenu", "Lock=loginctl lock-session"]
 package main
 
 import (
 	"bufio"
-	"bytes"
 	"cmp"
 	"context"
 	"errors"
+	"flag"
 	"fmt"
+	"math/rand/v2"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 // For build-time overriding
 var bemenu = "bemenu"
 
-var (
-	dataDir        = findDataDir()
+var dataDir, countsFileName, timesFileName, commandsFileName, durationsFileName string
+
+func init() {
+	setDataDir(findDataDir())
+}
+
+func setDataDir(dir string) {
+	dataDir = dir
 	countsFileName = dataDir + "/counts"
+	timesFileName = dataDir + "/times"
+	commandsFileName = dataDir + "/commands"
+	durationsFileName = dataDir + "/durations"
+}
+
+var (
+	dataDirFlag      = flag.String("data-dir", "", "keep all state in `DIR` instead of $XDG_DATA_HOME/rumenu, for this run only")
+	tieBreakMode     = flag.String("tie-break", "name", "order programs with equal counts by `MODE`: name, or path to put the ones from earlier PATH directories first")
+	rankDirs         = flag.String("rank-dirs", "", "colon-separated `DIRS` from PATH whose programs are sorted by count, above the rest sorted by name")
+	shuffleTies      = flag.Bool("shuffle-ties", false, "shuffle programs with equal counts instead of sorting them alphabetically")
+	seed             = flag.Uint64("seed", 0, "random seed for -shuffle-ties, for reproducible orderings (0 picks a random seed)")
+	source           = flag.String("source", "", "count launches separately under `TAG`, and rank by them")
+	combined         = flag.Bool("combined", false, "with -source, rank by the launches from all sources")
+	strict           = flag.Bool("strict", false, "exit with an error if the launch counts can't be saved")
+	topEntries       menuEntries
+	openers          = make(mappings)
+	aliases          = make(mappings)
+	list             = flag.Bool("list", false, "print the menu entries in order instead of showing the menu")
+	print0           = flag.Bool("print0", false, "with -list, separate entries with NUL bytes instead of newlines")
+	cooldown         = flag.Duration("cooldown", 0, "hide programs launched within the last `DURATION` from the menu; they can still be typed")
+	storeOrder       = flag.String("store-order", "count", "order the lines of the counts file by `KEY`: count, name, recent, or length; the menu order isn't affected")
+	installedAfter   = flag.String("installed-after", "", "hide programs last modified before `DATE` (YYYY-MM-DD) from the menu")
+	countVetoed      = flag.Bool("count-vetoed", false, "count programs whose launch was rejected by -pre-launch as if they had been launched")
+	countPolicy      = flag.String("count", "always", "which launches to count: always, or success to skip programs that exit with an error")
+	minRuntime       = flag.Duration("min-runtime", 0, "don't count launches of programs that exit successfully within `DURATION`, assuming they were misfires")
+	recentOnly       = flag.Bool("recent-only", false, "only show programs that have been launched before, instead of everything on PATH")
+	detachAfter      = flag.Duration("detach-after", 0, "stop waiting for the launched program after `DURATION`, reporting only errors from programs that exit before then")
+	showCommands     = flag.Int("commands", 0, "show the `N` most often run commands with arguments above the programs")
+	preLaunchHook    = flag.String("pre-launch", "", "run the shell `COMMAND` before each launch, for example to set up window placement; see the package documentation")
+	trackTime        = flag.Bool("track-time", false, "record how long each program runs in the foreground, shown by -stats")
+	noShell          = flag.Bool("no-shell", false, "run the selection directly, split into words, instead of with $SHELL")
+	safe             = flag.Bool("safe", false, "harden launching: imply -no-shell, only run programs on PATH, and give them a minimal environment")
+	sandboxCommand   = flag.String("sandbox", "", "run everything launched under the sandbox `COMMAND`, such as firejail")
+	sandboxFile      = flag.String("sandbox-profiles", findConfigDir()+"/sandbox", "run specific programs under their own sandbox command from `FILE`, which has a line per program with its name followed by the command")
+	capture          = flag.String("capture", "", "append the output of launched programs to `FILE`, or to a new file for each launch if FILE is a directory")
+	envFile          = flag.String("env-file", findConfigDir()+"/env", "set environment variables for specific programs from `FILE`, which has a line per program with its name followed by KEY=VALUE pairs")
+	showRankChange   = flag.Bool("show-rank-change", false, "print how the launched program moved in the ranking")
+	sourcePriority   = flag.String("priority", strings.Join(menuSources, ","), "comma-separated `ORDER` of top, commands, and path, deciding which one runs when entries from several of them have the same text")
+	filterCommand    = flag.String("filter", "", "shell `COMMAND` that reads the menu entries and prints the text to show for each, one per line")
+	recentCount      = flag.Int("recent", 0, "show the `N` most recently launched programs first, under -recent-header")
+	recentHeader     = flag.String("recent-header", "Recent:", "`TEXT` of the header above the -recent programs, which does nothing when selected")
+	clipboardCommand = flag.String("clipboard-cmd", "wl-paste -n", "shell `COMMAND` that prints the clipboard, for {clipboard} in -top commands")
+	askArgs          = flag.String("ask-args", "", "comma-separated `PROGRAMS` that prompt for their arguments when selected")
+	checkPathFlag    = flag.Bool("check-path", false, "report how many recorded programs are no longer on PATH, then exit")
+	importFrom       = flag.String("import-from", "", "merge the launch counts from the file named by the argument, in `FORMAT`: counts, for lines of a count, a space, and a program, like rofi's history, or list, for one launch of a program per line; then exit")
+	selfTestFlag     = flag.Bool("selftest", false, "check that counts can be saved, read back, and locked in the data directory, then exit")
+	stats            = flag.Bool("stats", false, "print the launch count, last launch time, and time spent in each program, then exit")
+	exportDir        = flag.String("export-desktop", "", "write a desktop file for each of the most launched programs to `DIR`, for launchers that read desktop files, then exit")
+	exportCount      = flag.Int("export-count", 20, "with -export-desktop, how many programs to export")
+	configDump       = flag.Bool("config-dump", false, "print every setting, its value, and where it was set, then exit")
+	touch            = flag.String("touch", "", "set the last launch time of `PROGRAM` to now, then exit")
+	untouch          = flag.String("untouch", "", "clear the last launch time of `PROGRAM`, then exit")
+	unlaunched       = flag.String("unlaunched", "bottom", "where to put programs that have never been launched: bottom, below everything launched at least once, or mixed, sorted among the programs launched once")
+	sortMode         = flag.String("sort", "frequency", "order programs by `MODE`: frequency, or newest to show the most recently installed first (slower, since it stats every program)")
 )
 
+func init() {
+	flag.Var(aliases, "alias", "let `NAME=COMMAND` be typed to run COMMAND, counted as the program it runs (can be repeated)")
+	flag.Var(openers, "open", "open typed file names with the extension EXT (without the dot) using COMMAND, given as `EXT=COMMAND` (can be repeated)")
+	flag.Var(&topEntries, "top", "show an entry `TEXT=COMMAND` at the top of the menu, which runs COMMAND when selected (can be repeated)")
+}
+
 func findDataDir() string {
 	dataDir := os.Getenv("XDG_DATA_HOME")
 	if dataDir == "" {
@@ -32,98 +285,504 @@ func findDataDir() string {
 	return dataDir
 }
 
-func rumenuPath() ([]string, error) {
+type pathEntry struct {
+	name    string
+	dir     int       // The index in PATH of the directory it's in.
+	modTime time.Time // Zero unless stat'ed successfully.
+}
+
+func rumenuPath(stat bool) ([]pathEntry, error) {
 	wg := new(sync.WaitGroup)
 	dirs := strings.Split(os.Getenv("PATH"), ":")
-	dirContents := make([][]string, len(dirs))
+	dirContents := make([][]pathEntry, len(dirs))
 	for i, d := range dirs {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			files, _ := os.ReadDir(d)
-			names := make([]string, 0, len(files))
+			entries := make([]pathEntry, 0, len(files))
 			for _, f := range files {
-				if name := f.Name(); !strings.Contains(name, "\n") {
-					names = append(names, name)
+				name := f.Name()
+				if strings.Contains(name, "\n") {
+					continue
+				}
+				e := pathEntry{name: name, dir: i}
+				if stat {
+					if info, err := os.Stat(d + "/" + name); err == nil {
+						e.modTime = info.ModTime()
+					}
 				}
+				entries = append(entries, e)
 			}
-			dirContents[i] = names
+			dirContents[i] = entries
 		}()
 	}
 	wg.Wait()
-	out := slices.Concat(dirContents...)
+	out := dedupPath(dirContents)
 	if len(out) == 0 {
 		return nil, errors.New("no files")
 	}
 	return out, nil
 }
 
-func readFreq() (map[string]int, error) {
-	countsFile, err := os.Open(countsFileName)
-	if err != nil {
-		return nil, err
+// dedupPath concatenates the contents of the PATH directories, leaving out
+// programs shadowed by one of the same name in an earlier directory.
+func dedupPath(dirContents [][]pathEntry) []pathEntry {
+	n := 0
+	for _, entries := range dirContents {
+		n += len(entries)
 	}
-	defer countsFile.Close()
-	counts := make(map[string]int)
-	lineNum := 0
-	scanner := bufio.NewScanner(countsFile)
-	for scanner.Scan() {
-		lineNum++
-		line := scanner.Text()
-		i := strings.LastIndex(line, "\t")
-		if i < 0 {
-			return counts, fmt.Errorf("%s:%d invalid syntax", countsFileName, lineNum)
+	// Sized for the worst case, to avoid growing either while scanning a
+	// large PATH.
+	seen := make(map[string]struct{}, n)
+	out := make([]pathEntry, 0, n)
+	for _, entries := range dirContents {
+		for _, e := range entries {
+			if _, ok := seen[e.name]; !ok {
+				seen[e.name] = struct{}{}
+				out = append(out, e)
+			}
 		}
-		name, countStr := line[:i], line[i+1:]
-		count, err := strconv.Atoi(countStr)
+	}
+	return out
+}
+
+// recentPath is like rumenuPath, but only finds the programs that have been
+// launched before.
+func recentPath(freq map[string]int, stat bool) ([]pathEntry, error) {
+	pathDirs := strings.Split(os.Getenv("PATH"), ":")
+	dirs := make(map[string]int)
+	for i, d := range pathDirs {
+		if _, ok := dirs[filepath.Clean(d)]; !ok {
+			dirs[filepath.Clean(d)] = i
+		}
+	}
+	var entries []pathEntry
+	for name := range freq {
+		if strings.Contains(name, "/") {
+			// Counted under a source tag.
+			continue
+		}
+		p, err := exec.LookPath(name)
 		if err != nil {
-			return counts, fmt.Errorf("%s:%d invalid syntax: %s", countsFileName, lineNum, err)
+			continue
+		}
+		dir, ok := dirs[filepath.Dir(p)]
+		if !ok {
+			// Found somewhere else, so after everything on PATH.
+			dir = len(pathDirs)
+		}
+		e := pathEntry{name: name, dir: dir}
+		if stat {
+			if info, err := os.Stat(p); err == nil {
+				e.modTime = info.ModTime()
+			}
+		}
+		entries = append(entries, e)
+	}
+	// Keep the order stable for -shuffle-ties.
+	slices.SortFunc(entries, func(x, y pathEntry) int { return strings.Compare(x.name, y.name) })
+	return entries, nil
+}
+
+// rankOf returns the position of prog in the menu, counting from 1, if
+// progs were sorted by compare.
+func rankOf(progs []string, prog string, compare func(x, y string) int) int {
+	n := 1
+	for _, p := range progs {
+		if p != prog && compare(p, prog) < 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// byCount orders programs by decreasing count in rank, then by tieBreak.
+// Programs that have never been launched come last if unlaunched is
+// "bottom", and are mixed in with the ones launched once if it's "mixed".
+func byCount(rank map[string]int, unlaunched string, tieBreak func(x, y string) int) func(x, y string) int {
+	count := func(p string) int {
+		if n := rank[p]; n > 0 || unlaunched == "bottom" {
+			return n
+		}
+		// Mixed in with the programs launched once.
+		return 1
+	}
+	return func(x, y string) int {
+		if n := cmp.Compare(count(y), count(x)); n != 0 {
+			return n
+		}
+		return tieBreak(x, y)
+	}
+}
+
+// inDirs returns whether a program is from one of the colon-separated
+// rankDirs, given the index in PATH of the directory each program is from.
+func inDirs(dirs map[string]int, rankDirs string) func(prog string) bool {
+	pathDirs := strings.Split(os.Getenv("PATH"), ":")
+	ranked := make([]bool, len(pathDirs))
+	for _, d := range strings.Split(rankDirs, ":") {
+		for i, pathDir := range pathDirs {
+			if filepath.Clean(d) == filepath.Clean(pathDir) {
+				ranked[i] = true
+			}
 		}
-		counts[name] = count
 	}
-	return counts, scanner.Err()
+	return func(p string) bool { return dirs[p] < len(ranked) && ranked[dirs[p]] }
 }
 
-func writeFreq(freq map[string]int) (err error) {
-	keys := make([]string, 0, len(freq))
-	for k := range freq {
-		keys = append(keys, k)
+// rankedFirst orders the programs for which ranked returns true by compare,
+// followed by the rest, ordered by tieBreak.
+func rankedFirst(ranked func(prog string) bool, compare, tieBreak func(x, y string) int) func(x, y string) int {
+	return func(x, y string) int {
+		switch rx, ry := ranked(x), ranked(y); {
+		case rx && ry:
+			return compare(x, y)
+		case rx:
+			return -1
+		case ry:
+			return 1
+		}
+		return tieBreak(x, y)
+	}
+}
+
+// shuffledOrder returns a comparison function that orders progs randomly.
+// The order only depends on progs and seed.
+func shuffledOrder(progs []string, seed uint64) func(x, y string) int {
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	r := rand.New(rand.NewPCG(seed, seed))
+	keys := make(map[string]int, len(progs))
+	for i, k := range r.Perm(len(progs)) {
+		keys[progs[i]] = k
 	}
-	slices.SortFunc(keys, func(x, y string) int {
-		if n := cmp.Compare(freq[y], freq[x]); n != 0 {
+	return func(x, y string) int {
+		if n := cmp.Compare(keys[x], keys[y]); n != 0 {
 			return n
 		}
 		return strings.Compare(x, y)
-	})
-	tempFile, err := os.CreateTemp(dataDir, "")
+	}
+}
+
+// sourceFreq returns the counts recorded under the given source tag.
+func sourceFreq(freq map[string]int, tag string) map[string]int {
+	counts := make(map[string]int)
+	for k, v := range freq {
+		if name, ok := strings.CutPrefix(k, tag+"/"); ok {
+			counts[name] = v
+		}
+	}
+	return counts
+}
+
+// checkPath reports the recorded programs that are no longer on PATH.
+func checkPath() error {
+	freq, err := readFreq(countsFileName)
 	if err != nil {
-		return fmt.Errorf("write counts: %s", err)
+		return err
 	}
-	defer func() {
-		if err != nil {
-			tempFile.Close()
-			os.Remove(tempFile.Name())
+	entries, err := rumenuPath(false)
+	if err != nil {
+		return err
+	}
+	onPath := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		onPath[e.name] = true
+	}
+	recorded := 0
+	var missing []string
+	for name := range freq {
+		if strings.Contains(name, "/") {
+			// Counted under a source tag.
+			continue
 		}
-	}()
-	w := bufio.NewWriter(tempFile)
-	for _, k := range keys {
-		if _, err := fmt.Fprintf(w, "%s\t%d\n", k, freq[k]); err != nil {
-			return fmt.Errorf("write counts: %s", err)
+		recorded++
+		if !onPath[name] {
+			missing = append(missing, name)
+		}
+	}
+	slices.Sort(missing)
+	fmt.Printf("%d of %d recorded programs (%d%%) are not on PATH\n", len(missing), recorded, len(missing)*100/max(recorded, 1))
+	for _, name := range missing {
+		fmt.Printf("  %s\n", name)
+	}
+	if len(missing) > 0 {
+		fmt.Printf("If they were uninstalled, consider removing them from %s\n", countsFileName)
+	}
+	return nil
+}
+
+// importFreq merges launch counts from another launcher's history file.
+func importFreq(format, fileName string) error {
+	if format != "counts" && format != "list" {
+		return fmt.Errorf("invalid import format %q", format)
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	imported := make(map[string]int)
+	lineNum := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		name, count := line, 1
+		if format == "counts" {
+			countStr, rest, ok := strings.Cut(line, " ")
+			if !ok {
+				return fmt.Errorf("%s:%d invalid syntax", fileName, lineNum)
+			}
+			if count, err = strconv.Atoi(countStr); err != nil || count <= 0 {
+				return fmt.Errorf("%s:%d invalid count %q", fileName, lineNum, countStr)
+			}
+			name = strings.TrimSpace(rest)
+		}
+		if name == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("%s:%d invalid program name %q", fileName, lineNum, name)
 		}
+		imported[name] += count
 	}
-	if err := w.Flush(); err != nil {
-		return fmt.Errorf("write counts: %s", err)
+	if err := scanner.Err(); err != nil {
+		return err
 	}
-	if err := tempFile.Close(); err != nil {
-		return fmt.Errorf("write counts: %s", err)
+
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return err
 	}
-	if err := os.Rename(tempFile.Name(), countsFileName); err != nil {
-		return fmt.Errorf("write counts: %s", err)
+	unlock, err := lockData(*lockTimeout)
+	if err != nil {
+		return err
 	}
+	defer unlock()
+	freq, err := readFreq(countsFileName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if freq == nil {
+		freq = make(map[string]int)
+	}
+	launches := 0
+	for name, count := range imported {
+		freq[name] += count
+		launches += count
+	}
+	times, err := readFreq(timesFileName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	order, err := countsOrder(freq, times)
+	if err != nil {
+		return err
+	}
+	if err := writeFreq(countsFileName, freq, order); err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d launches of %d programs from %s\n", launches, len(imported), fileName)
 	return nil
 }
 
+// promptArgs asks for arguments to prog with a second menu. It returns false
+// if the menu is cancelled.
+func promptArgs(ctx context.Context, prog string) (string, bool, error) {
+	args, err := showMenu(ctx, nil, "-p", prog)
+	if errors.As(err, new(*exec.ExitError)) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return args, true, nil
+}
+
+// preLaunch runs the -pre-launch hook before launching command. It returns
+// the command to run instead, which is the hook's output if there is any.
+func preLaunch(ctx context.Context, command, prog string) (string, error) {
+	hook := exec.CommandContext(ctx, "/bin/sh", "-c", *preLaunchHook)
+	hook.Env = append(os.Environ(), "RUMENU_COMMAND="+command, "RUMENU_PROGRAM="+prog)
+	hook.Stderr = os.Stderr
+	out, err := hook.Output()
+	if err != nil {
+		return "", fmt.Errorf("pre-launch hook rejected %s: %s", command, err)
+	}
+	if out := strings.TrimSpace(string(out)); out != "" {
+		return out, nil
+	}
+	return command, nil
+}
+
+// pasteClipboard replaces {clipboard} in command with the contents of the
+// clipboard, quoted for the shell unless -no-shell is given. If the
+// clipboard is empty, it returns false.
+func pasteClipboard(ctx context.Context, command string) (string, bool, error) {
+	paste := exec.CommandContext(ctx, "/bin/sh", "-c", *clipboardCommand)
+	paste.Stderr = os.Stderr
+	out, err := paste.Output()
+	text := strings.TrimSuffix(string(out), "\n")
+	// wl-paste and xclip exit with status 1 when there's nothing to paste.
+	var exitErr *exec.ExitError
+	if strings.TrimSpace(text) == "" && (err == nil || errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("read clipboard: %s", err)
+	}
+	if !*noShell && !*safe {
+		text = shellQuote(text)
+	}
+	return strings.ReplaceAll(command, "{clipboard}", text), true, nil
+}
+
+// openCapture opens the -capture file for the launch of name. If fileName
+// is a directory, a new file named after the program and the time is
+// created in it.
+func openCapture(fileName, name string) (*os.File, error) {
+	if info, err := os.Stat(fileName); err == nil && info.IsDir() {
+		fileName = filepath.Join(fileName, name+"-"+time.Now().Format("20060102-150405")+".log")
+	}
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("capture: %s", err)
+	}
+	return f, nil
+}
+
+// shellQuote quotes s as a single word for the shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// userShell returns the shell that runs the selection.
+func userShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "/bin/sh"
+}
+
+// launchCommand returns the command to launch the selection. Normally the
+// selection is run by the user's shell, but with -no-shell it's split into
+// words and run directly.
+func launchCommand(ctx context.Context, command string) *exec.Cmd {
+	if *noShell || *safe {
+		words := strings.Fields(command)
+		if len(words) == 0 {
+			words = []string{command}
+		}
+		cmd := exec.CommandContext(ctx, words[0], words[1:]...)
+		// Without a shell reading the command from stdin, it's free
+		// for interactive programs.
+		cmd.Stdin = os.Stdin
+		if *safe {
+			cmd.Env = minimalEnv()
+		}
+		return cmd
+	}
+	sh := exec.CommandContext(ctx, userShell())
+	sh.Stdin = strings.NewReader(command + "\n")
+	return sh
+}
+
+// minimalEnv returns the parts of the environment that programs need to
+// find the user's session, and nothing else.
+func minimalEnv() []string {
+	var env []string
+	for _, name := range []string{
+		"PATH", "HOME", "USER", "LOGNAME", "LANG", "LC_ALL", "TERM",
+		"DISPLAY", "XAUTHORITY", "WAYLAND_DISPLAY", "XDG_RUNTIME_DIR",
+		"DBUS_SESSION_BUS_ADDRESS",
+	} {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+	return env
+}
+
+// waitOrDetach waits up to d for a started cmd to exit. If it's still
+// running after that, it's left to run in the background.
+func waitOrDetach(cmd *exec.Cmd, d time.Duration) (detached bool, err error) {
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		return false, err
+	case <-time.After(d):
+		return true, nil
+	}
+}
+
+// touchProg sets the last launch time of prog to now, or clears it.
+func touchProg(prog string, clear bool) error {
+	freq, err := readFreq(countsFileName)
+	if err != nil {
+		return err
+	}
+	if _, ok := freq[prog]; !ok {
+		return fmt.Errorf("%s has never been launched", prog)
+	}
+	unlock, err := lockData(*lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	times, err := readFreq(timesFileName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if times == nil {
+		times = make(map[string]int)
+	}
+	if clear {
+		delete(times, prog)
+	} else {
+		times[prog] = int(time.Now().Unix())
+	}
+	return writeFreq(timesFileName, times, byValue(times), prog)
+}
+
 func run(ctx context.Context) error {
+	if *sortMode != "frequency" && *sortMode != "newest" {
+		return fmt.Errorf("invalid sort mode %q", *sortMode)
+	}
+	if *unlaunched != "bottom" && *unlaunched != "mixed" {
+		return fmt.Errorf("invalid -unlaunched policy %q", *unlaunched)
+	}
+	priority := strings.Split(*sourcePriority, ",")
+	p := slices.Clone(priority)
+	slices.Sort(p)
+	if !slices.Equal(p, []string{"commands", "path", "top"}) {
+		return fmt.Errorf("invalid -priority %q: must list top, commands, and path", *sourcePriority)
+	}
+	if *tieBreakMode != "name" && *tieBreakMode != "path" {
+		return fmt.Errorf("invalid -tie-break %q", *tieBreakMode)
+	}
+	if *countPolicy != "always" && *countPolicy != "success" {
+		return fmt.Errorf("invalid -count policy %q", *countPolicy)
+	}
+	if _, ok := menuInputs[*launcherInput]; !ok {
+		return fmt.Errorf("invalid -launcher-input %q", *launcherInput)
+	}
+	if _, err := countsOrder(nil, nil); err != nil {
+		return err
+	}
+	var minModTime time.Time
+	if *installedAfter != "" {
+		var err error
+		if minModTime, err = time.ParseInLocation(time.DateOnly, *installedAfter, time.Local); err != nil {
+			return fmt.Errorf("invalid -installed-after: %s", err)
+		}
+	}
+	if strings.ContainsAny(*source, "/\t\n") {
+		return fmt.Errorf("invalid source %q: must not contain a slash, tab, or newline", *source)
+	}
+
 	wg := new(sync.WaitGroup)
 
 	var freq map[string]int
@@ -131,56 +790,317 @@ func run(ctx context.Context) error {
 	go func() {
 		defer wg.Done()
 		var err error
-		if freq, err = readFreq(); err != nil {
+		if freq, err = readFreq(countsFileName); err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
 		}
 	}()
 
-	var progs []string
-	var err error
+	var times map[string]int
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		progs, err = rumenuPath()
+		var err error
+		if times, err = readFreq(timesFileName); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+		}
 	}()
 
+	var commandFreq map[string]int
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var err error
+		if commandFreq, err = readFreq(commandsFileName); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+		}
+	}()
+
+	stat := *sortMode == "newest" || !minModTime.IsZero()
+	var entries []pathEntry
+	var err error
+	if !*recentOnly {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entries, err = rumenuPath(stat)
+		}()
+	}
+
 	wg.Wait()
+	// Filled in when refreshed before saving, so the maps must be shared.
+	if freq == nil {
+		freq = make(map[string]int)
+	}
+	if times == nil {
+		times = make(map[string]int)
+	}
+	if commandFreq == nil {
+		commandFreq = make(map[string]int)
+	}
+	if *recentOnly {
+		entries, err = recentPath(freq, stat)
+	}
 	if err != nil {
 		return err
 	}
+	progs := make([]string, len(entries))
+	modTimes := make(map[string]time.Time)
+	dirs := make(map[string]int)
+	for i, e := range entries {
+		progs[i] = e.name
+		if _, ok := modTimes[e.name]; !ok {
+			modTimes[e.name] = e.modTime
+			dirs[e.name] = e.dir
+		}
+	}
 
-	compareProgs := func(x, y string) int {
-		if n := cmp.Compare(freq[y], freq[x]); n != 0 {
-			return n
+	rank := freq
+	if *source != "" && !*combined {
+		rank = sourceFreq(freq, *source)
+	}
+	tieBreak := strings.Compare
+	if *shuffleTies {
+		tieBreak = shuffledOrder(progs, *seed)
+	}
+	if *tieBreakMode == "path" {
+		byName := tieBreak
+		tieBreak = func(x, y string) int {
+			if n := cmp.Compare(dirs[x], dirs[y]); n != 0 {
+				return n
+			}
+			return byName(x, y)
+		}
+	}
+	compareProgs := byCount(rank, *unlaunched, tieBreak)
+	if *rankDirs != "" {
+		compareProgs = rankedFirst(inDirs(dirs, *rankDirs), compareProgs, tieBreak)
+	}
+	if *sortMode == "newest" {
+		// Programs that couldn't be stat'ed have a zero time, so they
+		// sort last.
+		compareProgs = func(x, y string) int {
+			if n := modTimes[y].Compare(modTimes[x]); n != 0 {
+				return n
+			}
+			return tieBreak(x, y)
 		}
-		return strings.Compare(x, y)
 	}
 	slices.SortFunc(progs, compareProgs)
 
-	bemenu := exec.CommandContext(ctx, bemenu)
-	bemenu.Stdin = strings.NewReader(strings.Join(progs, "\n") + "\n")
-	choiceBytes, err := bemenu.Output()
+	var hidden []func(prog string) bool
+	if *cooldown > 0 {
+		cutoff := time.Now().Add(-*cooldown).Unix()
+		hidden = append(hidden, func(p string) bool {
+			return int64(times[p]) > cutoff
+		})
+	}
+	if !minModTime.IsZero() {
+		// Keep programs that couldn't be stat'ed, rather than hiding
+		// something that works.
+		hidden = append(hidden, func(p string) bool {
+			t := modTimes[p]
+			return !t.IsZero() && t.Before(minModTime)
+		})
+	}
+	var fullCommands []string
+	if *showCommands > 0 {
+		for c := range commandFreq {
+			fullCommands = append(fullCommands, c)
+		}
+		slices.SortFunc(fullCommands, byValue(commandFreq))
+		fullCommands = fullCommands[:min(len(fullCommands), *showCommands)]
+	}
+	top := topEntries
+	var recent []string
+	if *recentCount > 0 {
+		for _, p := range progs {
+			if times[p] > 0 && !slices.ContainsFunc(hidden, func(h func(string) bool) bool { return h(p) }) {
+				recent = append(recent, p)
+			}
+		}
+		slices.SortStableFunc(recent, func(x, y string) int { return cmp.Compare(times[y], times[x]) })
+		recent = recent[:min(len(recent), *recentCount)]
+		if len(recent) > 0 && *recentHeader != "" {
+			// Selecting the header does nothing.
+			top = append(slices.Clip(top), menuEntry{*recentHeader, ""})
+		}
+	}
+	menu := buildMenu(top, aliases, recent, fullCommands, progs, priority, hidden...)
+
+	if *list {
+		sep := "\n"
+		if *print0 {
+			sep = "\x00"
+		}
+		w := bufio.NewWriter(os.Stdout)
+		for _, line := range menu.lines {
+			w.WriteString(line + sep)
+		}
+		return w.Flush()
+	}
+
+	if *filterCommand != "" {
+		if err := menu.filter(ctx, *filterCommand); err != nil {
+			return err
+		}
+	}
+
+	var launcherArgs []string
+	if *preselect {
+		if i := menu.topProgram; i > 0 {
+			launcherArgs = append(launcherArgs, *preselectArg, strconv.Itoa(i))
+		}
+	}
+	choice, err := showMenu(ctx, menu.shown(), launcherArgs...)
 	if err != nil {
-		return fmt.Errorf("bemenu: %w", err)
+		return err
 	}
-	choice := string(bytes.TrimSuffix(choiceBytes, []byte("\n")))
 	if choice == "" {
 		return nil
 	}
+	command, prog := menu.resolve(choice)
+	if command == "" {
+		return nil
+	}
+	if menu.isEntry(choice) && strings.Contains(command, "{clipboard}") {
+		var ok bool
+		if command, ok, err = pasteClipboard(ctx, command); err != nil {
+			return err
+		} else if !ok {
+			fmt.Fprintf(os.Stderr, "Warning: the clipboard is empty, not running %s\n", choice)
+			return nil
+		}
+	}
+	if words := strings.Fields(command); prog == "" && *recentOnly && len(words) > 0 && !menu.isEntry(choice) {
+		// Only programs launched before are in the menu, so look up
+		// anything else typed, for the history to grow.
+		if !strings.Contains(words[0], "/") {
+			if _, err := exec.LookPath(words[0]); err == nil {
+				prog = words[0]
+			}
+		}
+	}
+	counted := prog != ""
+	if !counted && !menu.isEntry(choice) {
+		ext := filepath.Ext(choice)
+		if opener, ok := openers[strings.TrimPrefix(ext, ".")]; ext != "" && ok {
+			fileName := choice
+			if !*noShell && !*safe {
+				fileName = shellQuote(fileName)
+			}
+			command = opener + " " + fileName
+		}
+	}
+	if prog == choice && slices.Contains(strings.Split(*askArgs, ","), choice) {
+		args, ok, err := promptArgs(ctx, choice)
+		if err != nil || !ok {
+			return err
+		}
+		if args != "" {
+			command += " " + args
+		}
+	}
+
+	if *safe && prog == "" {
+		return fmt.Errorf("%s: not a program on PATH, refusing to run it with -safe", choice)
+	}
+	// The command as chosen, before any hook rewrites it.
+	fullCommand := command
+	sandbox := *sandboxCommand
+	if counted {
+		if profile, err := readSandbox(*sandboxFile, prog); err != nil {
+			return err
+		} else if profile != "" {
+			sandbox = profile
+		}
+	}
+	if words := strings.Fields(sandbox); len(words) > 0 {
+		if _, err := exec.LookPath(words[0]); err != nil {
+			return fmt.Errorf("not launching %s without its sandbox: %s", command, err)
+		}
+		if *noShell || *safe {
+			command = sandbox + " " + command
+		} else {
+			// Run the shell itself in the sandbox, so that nothing in
+			// the command line can get outside it.
+			command = sandbox + " " + shellQuote(userShell()) + " -c " + shellQuote(command)
+		}
+	}
+	var vetoErr error
+	if *preLaunchHook != "" {
+		if command, err = preLaunch(ctx, command, prog); err != nil {
+			if !counted || !*countVetoed {
+				return err
+			}
+			vetoErr = err
+		}
+	}
+
+	var envOverlay []string
+	if counted {
+		if envOverlay, err = readEnvOverlay(*envFile, prog); err != nil {
+			return err
+		}
+	}
+
+	stdout, stderr := os.Stdout, os.Stderr
+	if *capture != "" && vetoErr == nil {
+		name := prog
+		if words := strings.Fields(fullCommand); name == "" && len(words) > 0 {
+			name = filepath.Base(words[0])
+		}
+		log, err := openCapture(*capture, name)
+		if err != nil {
+			return err
+		}
+		defer log.Close()
+		stdout, stderr = log, log
+	}
 
 	var progErr error
+	// With -min-runtime, -count=success, or -track-time, what to record is
+	// only known once the program exits.
+	type launchResult struct {
+		err      error
+		runtime  time.Duration
+		detached bool
+	}
+	launched := make(chan launchResult, 1)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		shell := os.Getenv("SHELL")
-		if shell == "" {
-			shell = "/bin/sh"
-		}
-		sh := exec.CommandContext(ctx, shell)
-		sh.Stdin = strings.NewReader(choice + "\n")
-		sh.Stdout = os.Stdout
-		sh.Stderr = os.Stderr
-		if err := sh.Run(); err != nil {
+		if vetoErr != nil {
+			progErr = vetoErr
+			return
+		}
+		sh := launchCommand(ctx, command)
+		if envOverlay != nil {
+			if sh.Env == nil {
+				sh.Env = os.Environ()
+			}
+			sh.Env = append(sh.Env, envOverlay...)
+		}
+		sh.Stdout = stdout
+		sh.Stderr = stderr
+		start := time.Now()
+		var detached bool
+		err := sh.Start()
+		if err == nil {
+			if *dbusSignal != "" {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					emitLaunch(ctx, prog, fullCommand)
+				}()
+			}
+			if *detachAfter > 0 {
+				detached, err = waitOrDetach(sh, *detachAfter)
+			} else {
+				err = sh.Wait()
+			}
+		}
+		launched <- launchResult{err, time.Since(start), detached}
+		if err != nil {
 			progErr = fmt.Errorf("%s: %w", choice, err)
 		}
 	}()
@@ -189,29 +1109,122 @@ func run(ctx context.Context) error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		if !counted {
+			return
+		}
+		var result launchResult
+		if vetoErr == nil && (*minRuntime > 0 || *countPolicy == "success" || *trackTime) {
+			result = <-launched
+			if result.err == nil && !result.detached && result.runtime < *minRuntime {
+				return
+			}
+			if result.err != nil && *countPolicy == "success" {
+				return
+			}
+		}
 		if writeFreqErr = os.MkdirAll(dataDir, 0755); writeFreqErr != nil {
 			return
 		}
+		unlock, err := lockData(*lockTimeout)
+		if err != nil {
+			writeFreqErr = fmt.Errorf("not saving counts: %s", err)
+			return
+		}
+		defer unlock()
+		// Another instance may have saved since the files were read.
+		refreshFreq(freq, countsFileName)
+		refreshFreq(times, timesFileName)
+		refreshFreq(commandFreq, commandsFileName)
 
-		if _, ok := slices.BinarySearchFunc(progs, choice, compareProgs); !ok {
+		before := 0
+		if *showRankChange {
+			before = rankOf(progs, prog, compareProgs)
+		}
+		freq[prog]++
+		changed := []string{prog}
+		if *source != "" {
+			freq[*source+"/"+prog]++
+			changed = append(changed, *source+"/"+prog)
+		}
+		if *showRankChange {
+			if *source != "" && !*combined {
+				rank[prog]++
+			}
+			fmt.Fprintf(os.Stderr, "%s: #%d → #%d\n", prog, before, rankOf(progs, prog, compareProgs))
+		}
+		times[prog] = int(time.Now().Unix())
+		var order func(x, y string) int
+		if order, writeFreqErr = countsOrder(freq, times); writeFreqErr != nil {
 			return
 		}
-		if freq == nil {
-			freq = make(map[string]int)
+		if writeFreqErr = writeFreq(countsFileName, freq, order, changed...); writeFreqErr != nil {
+			return
+		}
+		if writeFreqErr = writeFreq(timesFileName, times, byValue(times), prog); writeFreqErr != nil {
+			return
+		}
+		if fullCommand != prog {
+			commandFreq[fullCommand]++
+			if writeFreqErr = writeFreq(commandsFileName, commandFreq, byValue(commandFreq), fullCommand); writeFreqErr != nil {
+				return
+			}
+		}
+		if *trackTime && vetoErr == nil && !result.detached {
+			var durations map[string]int
+			if durations, writeFreqErr = readFreq(durationsFileName); writeFreqErr != nil && !errors.Is(writeFreqErr, os.ErrNotExist) {
+				return
+			}
+			if durations == nil {
+				durations = make(map[string]int)
+			}
+			durations[prog] += int(result.runtime.Round(time.Second) / time.Second)
+			writeFreqErr = writeFreq(durationsFileName, durations, byValue(durations), prog)
 		}
-		freq[choice]++
-		writeFreqErr = writeFreq(freq)
 	}()
 
 	wg.Wait()
 	if progErr != nil {
 		return progErr
 	}
+	if writeFreqErr != nil && !*strict {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", writeFreqErr)
+		return nil
+	}
 	return writeFreqErr
 }
 
 func main() {
-	err := run(context.Background())
+	err := loadConfig()
+	parseFlags()
+	if err == nil && *dataDirFlag != "" {
+		setDataDir(*dataDirFlag)
+		err = os.MkdirAll(dataDir, 0755)
+	}
+	switch {
+	case err != nil:
+	case *importFrom != "":
+		if flag.NArg() != 1 {
+			err = errors.New("-import-from needs exactly one file name")
+			break
+		}
+		err = importFreq(*importFrom, flag.Arg(0))
+	case *exportDir != "":
+		err = exportDesktop(*exportDir, *exportCount)
+	case *stats:
+		err = printStats()
+	case *checkPathFlag:
+		err = checkPath()
+	case *selfTestFlag:
+		err = selfTest()
+	case *configDump:
+		err = dumpConfig()
+	case *touch != "":
+		err = touchProg(*touch, false)
+	case *untouch != "":
+		err = touchProg(*untouch, true)
+	default:
+		err = run(context.Background())
+	}
 	var bemenuErr *exec.ExitError
 	if errors.As(err, &bemenuErr) {
 		os.Exit(bemenuErr.ExitCode())
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// makePath creates a directory of empty executables for each of dirs, and
+// sets PATH to them, with trailing slashes.
+func makePath(t *testing.T, dirs ...[]string) []string {
+	t.Helper()
+	root := t.TempDir()
+	var path string
+	var dirNames []string
+	for i, progs := range dirs {
+		dir := filepath.Join(root, string(rune('a'+i)))
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, prog := range progs {
+			if err := os.WriteFile(filepath.Join(dir, prog), []byte("#!/bin/sh\n"), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if path != "" {
+			path += ":"
+		}
+		path += dir + "/"
+		dirNames = append(dirNames, dir)
+	}
+	t.Setenv("PATH", path)
+	return dirNames
+}
+
+func TestRecentPathDirs(t *testing.T) {
+	makePath(t, []string{"zz"}, []string{"aa"})
+	entries, err := recentPath(map[string]int{"aa": 1, "zz": 1, "TAG/aa": 1}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []pathEntry{{name: "aa", dir: 1}, {name: "zz", dir: 0}}
+	if len(entries) != len(want) {
+		t.Fatalf("recentPath() = %v, want %v", entries, want)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("recentPath()[%d] = %v, want %v", i, entries[i], want[i])
+		}
+	}
+}
+
+func TestByCount(t *testing.T) {
+	rank := map[string]int{"many": 5, "once": 1, "zonce": 1, "never": 0}
+	progs := []string{"zonce", "never", "unknown", "once", "many"}
+	tests := []struct {
+		unlaunched string
+		want       []string
+	}{
+		{"bottom", []string{"many", "once", "zonce", "never", "unknown"}},
+		{"mixed", []string{"many", "never", "once", "unknown", "zonce"}},
+	}
+	for _, test := range tests {
+		got := slices.Clone(progs)
+		slices.SortFunc(got, byCount(rank, test.unlaunched, strings.Compare))
+		if !slices.Equal(got, test.want) {
+			t.Errorf("-unlaunched=%s: sorted %v, want %v", test.unlaunched, got, test.want)
+		}
+	}
+}
+
+func TestRankDirsRecentOnly(t *testing.T) {
+	dirs := makePath(t, []string{"zz", "yy"}, []string{"aa", "bb"})
+	freq := map[string]int{"aa": 9, "bb": 1, "yy": 1, "zz": 5}
+	entries, err := recentPath(freq, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	progs := make([]string, len(entries))
+	progDirs := make(map[string]int)
+	for i, e := range entries {
+		progs[i] = e.name
+		progDirs[e.name] = e.dir
+	}
+	ranked := inDirs(progDirs, dirs[0])
+	slices.SortFunc(progs, rankedFirst(ranked, byCount(freq, "bottom", strings.Compare), strings.Compare))
+	if want := []string{"zz", "yy", "aa", "bb"}; !slices.Equal(progs, want) {
+		t.Errorf("-rank-dirs %s sorted %v, want %v", dirs[0], progs, want)
+	}
+}
+
+// benchPath is a PATH of 10 directories of 5000 programs each, half of them
+// shadowing programs in the directory before.
+func benchPath() [][]pathEntry {
+	dirContents := make([][]pathEntry, 10)
+	for i := range dirContents {
+		for j := range 5000 {
+			dirContents[i] = append(dirContents[i], pathEntry{name: fmt.Sprintf("prog%05d", i*2500+j)})
+		}
+	}
+	return dirContents
+}
+
+// naiveDedupPath is what dedupPath replaced, kept to compare against.
+func naiveDedupPath(dirContents [][]pathEntry) []pathEntry {
+	seen := make(map[string]bool)
+	var out []pathEntry
+	for _, e := range slices.Concat(dirContents...) {
+		if !seen[e.name] {
+			seen[e.name] = true
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func TestDedupPath(t *testing.T) {
+	dirContents := benchPath()
+	got, want := dedupPath(dirContents), naiveDedupPath(dirContents)
+	if !slices.Equal(got, want) {
+		t.Errorf("dedupPath() returned %d entries, want the %d from naiveDedupPath()", len(got), len(want))
+	}
+}
+
+func BenchmarkDedupPath(b *testing.B) {
+	dirContents := benchPath()
+	for range b.N {
+		dedupPath(dirContents)
+	}
+}
+
+func BenchmarkNaiveDedupPath(b *testing.B) {
+	dirContents := benchPath()
+	for range b.N {
+		naiveDedupPath(dirContents)
+	}
+}
+
+// setTestFlag sets a flag for the rest of the test.
+func setTestFlag(t *testing.T, name, value string) {
+	t.Helper()
+	old := flag.Lookup(name).Value.String()
+	if err := flag.Set(name, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { flag.Set(name, old) })
+}
+
+// captureStderr returns what f writes to os.Stderr.
+func captureStderr(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+	out := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- b
+	}()
+	f()
+	w.Close()
+	return string(<-out)
+}
+
+func TestRunSaveFails(t *testing.T) {
+	dirs := makePath(t, []string{"prog"})
+	t.Setenv("SHELL", "/bin/sh")
+	setTestFlag(t, "launcher", "/bin/echo prog")
+	setTestFlag(t, "env-file", dirs[0]+"/none")
+	setTestFlag(t, "sandbox-profiles", dirs[0]+"/none")
+	// The data directory can't be created where a file is in the way.
+	oldDataDir := dataDir
+	setDataDir(dirs[0] + "/prog/rumenu")
+	t.Cleanup(func() { setDataDir(oldDataDir) })
+
+	for _, strict := range []bool{false, true} {
+		setTestFlag(t, "strict", fmt.Sprint(strict))
+		var err error
+		stderr := captureStderr(t, func() { err = run(context.Background()) })
+		if strict {
+			if err == nil {
+				t.Error("-strict: run() succeeded, want an error for the failed save")
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("run() = %v, want only a warning", err)
+		}
+		if !strings.Contains(stderr, "Warning: mkdir "+dirs[0]+"/prog") {
+			t.Errorf("run() printed %q, want a warning about the data directory", stderr)
+		}
+	}
+}
+
+// setupRun prepares to call run, with a launcher that selects choice, a
+// PATH of progs, and a new data directory. It returns a scratch directory.
+func setupRun(t *testing.T, choice string, progs ...string) string {
+	t.Helper()
+	dir := makePath(t, progs)[0]
+	t.Setenv("SHELL", "/bin/sh")
+	setTestFlag(t, "launcher", "/bin/echo "+choice)
+	setTestFlag(t, "env-file", dir+"/none")
+	setTestFlag(t, "sandbox-profiles", dir+"/none")
+	oldDataDir := dataDir
+	setDataDir(t.TempDir())
+	t.Cleanup(func() { setDataDir(oldDataDir) })
+	return t.TempDir()
+}
+
+func TestRunTopEntryWithExtension(t *testing.T) {
+	dir := setupRun(t, "README.md", "prog")
+	if err := topEntries.Set("README.md=/bin/touch " + dir + "/top"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { topEntries = nil })
+	openers["md"] = "true"
+	t.Cleanup(func() { clear(openers) })
+	if err := run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir + "/top"); err != nil {
+		t.Errorf("the -top entry wasn't run: %s", err)
+	}
+}
+
+func TestRunRecentOnlyEmptyHistory(t *testing.T) {
+	setupRun(t, "glow README.md", "glow")
+	setTestFlag(t, "recent-only", "true")
+	if err := run(context.Background()); err != nil {
+		t.Fatalf("run() with no history = %v", err)
+	}
+	freq, err := readFreq(countsFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freq["glow"] != 1 {
+		t.Errorf("counts = %v after typing glow, want it counted", freq)
+	}
+}
+
+func TestRunOpenQuotesFileName(t *testing.T) {
+	for _, name := range []string{"my notes.md", "it's.md"} {
+		dir := setupRun(t, "", "prog")
+		setTestFlag(t, "launcher", "/bin/echo "+dir+"/"+name)
+		openers["md"] = "/bin/touch"
+		t.Cleanup(func() { clear(openers) })
+		if err := run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(dir + "/" + name); err != nil {
+			t.Errorf("%q wasn't opened: %s", name, err)
+		}
+	}
+}
+
+func TestPasteClipboard(t *testing.T) {
+	tests := []struct {
+		clipboardCmd string
+		want         string
+		wantOK       bool
+		wantErr      bool
+	}{
+		{"echo \"it's\"", "open 'it'\\''s'", true, false},
+		{"true", "", false, false},
+		{"echo '  '", "", false, false},
+		// What wl-paste and xclip do when there's nothing to paste.
+		{"exit 1", "", false, false},
+		{"nosuchcmd", "", false, true},
+		{"echo partial; exit 1", "", false, true},
+	}
+	for _, test := range tests {
+		setTestFlag(t, "clipboard-cmd", test.clipboardCmd)
+		var got string
+		var ok bool
+		var err error
+		captureStderr(t, func() { got, ok, err = pasteClipboard(context.Background(), "open {clipboard}") })
+		if got != test.want || ok != test.wantOK || (err != nil) != test.wantErr {
+			t.Errorf("with -clipboard-cmd %q, pasteClipboard() = %q, %t, %v, want %q, %t, error %t", test.clipboardCmd, got, ok, err, test.want, test.wantOK, test.wantErr)
+		}
+	}
+}
+
+func TestShuffledOrder(t *testing.T) {
+	var progs []string
+	for i := range 50 {
+		progs = append(progs, fmt.Sprintf("prog%02d", i))
+	}
+	shuffled := func(seed uint64) []string {
+		got := slices.Clone(progs)
+		slices.SortFunc(got, shuffledOrder(progs, seed))
+		return got
+	}
+	first := shuffled(42)
+	if again := shuffled(42); !slices.Equal(first, again) {
+		t.Errorf("the same seed gave different orders:\n%v\n%v", first, again)
+	}
+	if slices.Equal(first, progs) {
+		t.Errorf("order wasn't shuffled: %v", first)
+	}
+	if other := shuffled(43); slices.Equal(first, other) {
+		t.Errorf("different seeds gave the same order: %v", first)
+	}
+
+	// Ties are only shuffled among programs with the same count.
+	rank := make(map[string]int)
+	for i, p := range progs {
+		rank[p] = i % 3
+	}
+	got := slices.Clone(progs)
+	slices.SortFunc(got, byCount(rank, "bottom", shuffledOrder(progs, 42)))
+	if !slices.IsSortedFunc(got, func(x, y string) int { return rank[y] - rank[x] }) {
+		t.Errorf("shuffling mixed up counts: %v", got)
+	}
+}
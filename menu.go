@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// A menuEntry is a fixed menu entry that runs a command instead of a
+// program from PATH.
+type menuEntry struct {
+	text, command string
+}
+
+type menuEntries []menuEntry
+
+func (m *menuEntries) String() string {
+	texts := make([]string, len(*m))
+	for i, e := range *m {
+		texts[i] = e.text + "=" + e.command
+	}
+	return strings.Join(texts, ",")
+}
+
+func (m *menuEntries) Set(s string) error {
+	text, command, ok := strings.Cut(s, "=")
+	if !ok || text == "" {
+		return errors.New("expected TEXT=COMMAND")
+	}
+	if strings.Contains(s, "\n") {
+		return errors.New("must not contain a newline")
+	}
+	*m = append(*m, menuEntry{text, command})
+	return nil
+}
+
+// mappings is a flag holding KEY=VALUE pairs.
+type mappings map[string]string
+
+func (m mappings) String() string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m mappings) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return errors.New("expected KEY=VALUE")
+	}
+	m[k] = v
+	return nil
+}
+
+// A menu is the list of entries to show, along with what selecting each one
+// does.
+type menu struct {
+	lines []string
+	// commands holds the command run by each entry that doesn't just run
+	// its own text.
+	commands map[string]string
+	// counted holds the programs whose launches are counted.
+	counted map[string]bool
+	// aliases maps short names that can be typed to the commands they run.
+	aliases map[string]string
+	// display holds the lines as shown by the launcher, if they've been
+	// changed by -filter, and original maps them back to lines.
+	display  []string
+	original map[string]string
+	// topProgram is the index in lines of the top-ranked program from
+	// PATH, or -1 if there isn't one.
+	topProgram int
+}
+
+// The sources of menu entries, in the default order of priority.
+var menuSources = []string{"top", "commands", "path"}
+
+// buildMenu puts together the menu from the fixed entries, the recently
+// launched programs, the full commands to show, and the sorted programs
+// found on PATH. Programs for which any of
+// hidden returns true are left out of the menu, but they're still counted
+// when typed.
+//
+// Entries with the same text are only shown once, where the first one is,
+// but selecting them runs the entry from the source that comes first in
+// priority.
+func buildMenu(top []menuEntry, aliases map[string]string, recent, fullCommands, progs []string, priority []string, hidden ...func(prog string) bool) *menu {
+	m := &menu{
+		lines:    make([]string, 0, len(top)+len(recent)+len(fullCommands)+len(progs)),
+		commands: make(map[string]string, len(top)),
+		counted:  make(map[string]bool, len(progs)),
+		aliases:  aliases,
+	}
+
+	owner := make(map[string]string)
+	for _, source := range priority {
+		var texts []string
+		switch source {
+		case "top":
+			for _, e := range top {
+				texts = append(texts, e.text)
+			}
+		case "commands":
+			texts = fullCommands
+		case "path":
+			texts = progs
+		}
+		for _, text := range texts {
+			if _, ok := owner[text]; !ok {
+				owner[text] = source
+			}
+		}
+	}
+
+	shown := make(map[string]bool)
+	show := func(line string) {
+		if !shown[line] {
+			shown[line] = true
+			m.lines = append(m.lines, line)
+		}
+	}
+	for _, e := range top {
+		if owner[e.text] != "top" {
+			continue
+		}
+		if _, ok := m.commands[e.text]; !ok {
+			m.commands[e.text] = e.command
+		}
+		show(e.text)
+	}
+	for _, p := range recent {
+		show(p)
+	}
+	for _, c := range fullCommands {
+		show(c)
+	}
+	m.topProgram = -1
+	for _, p := range progs {
+		if owner[p] == "path" {
+			m.counted[p] = true
+		}
+		if !slices.ContainsFunc(hidden, func(h func(string) bool) bool { return h(p) }) {
+			show(p)
+			if m.topProgram < 0 && m.counted[p] {
+				m.topProgram = slices.Index(m.lines, p)
+			}
+		}
+	}
+	return m
+}
+
+// resolve returns the command to run for the selected or typed line, and the
+// program to count its launch for, if any. Commands with arguments are
+// counted for the program they run.
+//
+// Menu entries take precedence over programs, which take precedence over
+// aliases. If the first word of a typed command is an alias, it's replaced by
+// what it stands for.
+func (m *menu) resolve(choice string) (command, prog string) {
+	if line, ok := m.original[choice]; ok {
+		choice = line
+	}
+	if command, ok := m.commands[choice]; ok {
+		return command, ""
+	}
+	if m.counted[choice] {
+		return choice, choice
+	}
+	words := strings.Fields(choice)
+	if len(words) == 0 {
+		return choice, ""
+	}
+	command = choice
+	if alias, ok := m.aliases[words[0]]; ok && !m.counted[words[0]] {
+		command = strings.Join(append([]string{alias}, words[1:]...), " ")
+		words = strings.Fields(command)
+		if len(words) == 0 {
+			return command, ""
+		}
+	}
+	if m.counted[words[0]] {
+		return command, words[0]
+	}
+	return command, ""
+}
+
+// isEntry returns whether choice selects one of the fixed entries.
+func (m *menu) isEntry(choice string) bool {
+	if line, ok := m.original[choice]; ok {
+		choice = line
+	}
+	_, ok := m.commands[choice]
+	return ok
+}
+
+// shown returns the lines to show in the launcher.
+func (m *menu) shown() []string {
+	if m.display != nil {
+		return m.display
+	}
+	return m.lines
+}
+
+// filter runs the lines through a shell command, which prints the text to
+// show for each of them, one per line, in the same order.
+func (m *menu) filter(ctx context.Context, command string) error {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Stdin = strings.NewReader(strings.Join(m.lines, "\n") + "\n")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("filter: %s", err)
+	}
+	display := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if len(m.lines) == 0 {
+		display = nil
+	}
+	if len(display) != len(m.lines) {
+		return fmt.Errorf("filter printed %d lines for %d menu entries", len(display), len(m.lines))
+	}
+	m.display = display
+	m.original = make(map[string]string, len(display))
+	for i, text := range display {
+		if _, ok := m.original[text]; !ok {
+			m.original[text] = m.lines[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBuildMenuPriority(t *testing.T) {
+	top := []menuEntry{{"x", "run top"}}
+	tests := []struct {
+		priority    string
+		wantCommand string
+		wantProg    string
+	}{
+		{"top,commands,path", "run top", ""},
+		{"top,path,commands", "run top", ""},
+		{"commands,top,path", "x", ""},
+		{"commands,path,top", "x", ""},
+		{"path,top,commands", "x", "x"},
+		{"path,commands,top", "x", "x"},
+	}
+	for _, test := range tests {
+		m := buildMenu(top, nil, nil, []string{"x"}, []string{"x", "y"}, strings.Split(test.priority, ","))
+		if want := []string{"x", "y"}; !slices.Equal(m.lines, want) {
+			t.Errorf("-priority %s: lines = %q, want %q", test.priority, m.lines, want)
+		}
+		command, prog := m.resolve("x")
+		if command != test.wantCommand || prog != test.wantProg {
+			t.Errorf("-priority %s: resolve(%q) = %q, %q, want %q, %q", test.priority, "x", command, prog, test.wantCommand, test.wantProg)
+		}
+	}
+}
+
+func TestBuildMenu(t *testing.T) {
+	top := []menuEntry{{"Lock", "loginctl lock-session"}, {"Lock", "ignored"}}
+	aliases := map[string]string{"ff": "firefox", "foot": "ignored"}
+	fullCommands := []string{"foot -e htop", "Lock"}
+	progs := []string{"foot", "firefox", "secret"}
+	hidden := func(p string) bool { return p == "secret" }
+	m := buildMenu(top, aliases, []string{"firefox"}, fullCommands, progs, menuSources, hidden)
+
+	if want := []string{"Lock", "firefox", "foot -e htop", "foot"}; !slices.Equal(m.lines, want) {
+		t.Errorf("lines = %q, want %q", m.lines, want)
+	}
+	tests := []struct {
+		choice, command, prog string
+	}{
+		{"Lock", "loginctl lock-session", ""},
+		{"foot", "foot", "foot"},
+		{"foot -e htop", "foot -e htop", "foot"},
+		// Hidden programs are still counted when typed.
+		{"secret", "secret", "secret"},
+		{"ff example.com", "firefox example.com", "firefox"},
+		{"ff", "firefox", "firefox"},
+		// Programs take precedence over aliases.
+		{"foot -e top", "foot -e top", "foot"},
+		{"echo hi", "echo hi", ""},
+		{"  ", "  ", ""},
+	}
+	for _, test := range tests {
+		command, prog := m.resolve(test.choice)
+		if command != test.command || prog != test.prog {
+			t.Errorf("resolve(%q) = %q, %q, want %q, %q", test.choice, command, prog, test.command, test.prog)
+		}
+	}
+}
+
+func TestMenuFilter(t *testing.T) {
+	m := buildMenu([]menuEntry{{"Lock", "loginctl lock-session"}}, nil, nil, nil, []string{"foot"}, menuSources)
+	if err := m.filter(context.Background(), "sed 's/^/> /'"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"> Lock", "> foot"}; !slices.Equal(m.shown(), want) {
+		t.Errorf("shown() = %q, want %q", m.shown(), want)
+	}
+	if want := []string{"Lock", "foot"}; !slices.Equal(m.lines, want) {
+		t.Errorf("lines = %q, want %q", m.lines, want)
+	}
+	tests := []struct {
+		choice, command, prog string
+	}{
+		{"> Lock", "loginctl lock-session", ""},
+		{"> foot", "foot", "foot"},
+		// Typed text isn't filtered.
+		{"foot", "foot", "foot"},
+	}
+	for _, test := range tests {
+		command, prog := m.resolve(test.choice)
+		if command != test.command || prog != test.prog {
+			t.Errorf("resolve(%q) = %q, %q, want %q, %q", test.choice, command, prog, test.command, test.prog)
+		}
+	}
+
+	if err := m.filter(context.Background(), "head -1"); err == nil {
+		t.Error("filter() accepted fewer lines than menu entries")
+	}
+}
+
+func TestTopProgram(t *testing.T) {
+	tests := []struct {
+		recent []string
+		want   int
+	}{
+		{nil, 2},
+		// Recently launched programs come before the rest, but aren't
+		// the top-ranked one.
+		{[]string{"bar"}, 3},
+		// Unless it's one of them.
+		{[]string{"bar", "foo"}, 2},
+	}
+	for _, test := range tests {
+		m := buildMenu([]menuEntry{{"Lock", "loginctl lock-session"}}, nil, test.recent, []string{"foo -v"}, []string{"foo", "bar"}, menuSources)
+		if got := m.topProgram; got != test.want {
+			t.Errorf("with -recent %q, topProgram = %d (%q), want %d", test.recent, got, m.lines, test.want)
+		}
+	}
+	if m := buildMenu(nil, nil, nil, nil, nil, menuSources); m.topProgram != -1 {
+		t.Errorf("topProgram = %d for an empty menu, want -1", m.topProgram)
+	}
+}
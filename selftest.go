@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// selfTest checks that counts can be saved and read back in the data
+// directory, printing the result of each check. It works in a scratch
+// directory inside the data directory, so that it runs on the same
+// filesystem, and removes it afterwards.
+func selfTest() (err error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return err
+	}
+	scratch, err := os.MkdirTemp(dataDir, "selftest")
+	if err != nil {
+		return err
+	}
+	defer func(dir string) {
+		setDataDir(dir)
+		if rmErr := os.RemoveAll(scratch); rmErr != nil && err == nil {
+			err = rmErr
+		}
+	}(dataDir)
+	setDataDir(scratch)
+
+	first := map[string]int{"firefox": 3, "foot": 12, "with space": 1, "TAG/foot": 2}
+	second := maps.Clone(first)
+	second["firefox"]++
+	tests := []struct {
+		name string
+		test func() error
+	}{
+		{"round trip", func() error {
+			if err := writeFreq(countsFileName, first, byValue(first)); err != nil {
+				return err
+			}
+			return checkFreq(countsFileName, first)
+		}},
+		{"replace", func() error {
+			if err := writeFreq(countsFileName, second, byValue(second)); err != nil {
+				return err
+			}
+			return checkFreq(countsFileName, second)
+		}},
+		{"backup", func() error {
+			if *sharded {
+				return checkFreq(shardName(countsFileName, "firefox")+".bak", map[string]int{"firefox": 3, "foot": 12})
+			}
+			return checkFreq(countsFileName+".bak", first)
+		}},
+		{"no temporary files left", func() error {
+			entries, err := os.ReadDir(scratch)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				if !strings.HasPrefix(e.Name(), filepath.Base(countsFileName)) {
+					return fmt.Errorf("unexpected file %s", e.Name())
+				}
+			}
+			return nil
+		}},
+		{"lock", func() error {
+			unlock, err := lockData(0)
+			if err != nil {
+				return err
+			}
+			if unlockAgain, err := lockData(50 * time.Millisecond); err == nil {
+				unlockAgain()
+				unlock()
+				return errors.New("lock taken twice")
+			}
+			unlock()
+			unlock, err = lockData(0)
+			if err != nil {
+				return fmt.Errorf("not released: %s", err)
+			}
+			unlock()
+			return nil
+		}},
+	}
+	failed := 0
+	for _, t := range tests {
+		if err := t.test(); err != nil {
+			failed++
+			fmt.Printf("FAIL  %s: %s\n", t.name, err)
+			continue
+		}
+		fmt.Printf("ok    %s\n", t.name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d self-tests failed", failed, len(tests))
+	}
+	return nil
+}
+
+// checkFreq checks that a counts file holds exactly want.
+func checkFreq(fileName string, want map[string]int) error {
+	got, err := readFreqFile(fileName)
+	if *sharded && !strings.HasSuffix(fileName, ".bak") {
+		got, err = readFreq(fileName)
+	}
+	if err != nil {
+		return err
+	}
+	if !maps.Equal(got, want) {
+		return fmt.Errorf("read back %v, want %v", got, want)
+	}
+	return nil
+}
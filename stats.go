@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// printStats prints a table of the recorded programs, most launched first.
+func printStats() error {
+	freq, err := readFreq(countsFileName)
+	if err != nil {
+		return err
+	}
+	times, err := readFreq(timesFileName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	durations, err := readFreq(durationsFileName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	progs := make([]string, 0, len(freq))
+	for name := range freq {
+		if !strings.Contains(name, "/") {
+			progs = append(progs, name)
+		}
+	}
+	slices.SortFunc(progs, byValue(freq))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PROGRAM\tLAUNCHES\tLAST LAUNCHED\tTIME SPENT")
+	for _, name := range progs {
+		lastLaunched := "-"
+		if t, ok := times[name]; ok {
+			lastLaunched = time.Unix(int64(t), 0).Format(time.DateTime)
+		}
+		timeSpent := "-"
+		if d, ok := durations[name]; ok {
+			timeSpent = (time.Duration(d) * time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", name, freq[name], lastLaunched, timeSpent)
+	}
+	return w.Flush()
+}
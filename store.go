@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var sharded = flag.Bool("sharded", false, "split each counts file into parts by the first byte of each name, so that saving a launch only rewrites one part, for very large histories")
+
+// readFreq reads a counts file.
+func readFreq(fileName string) (map[string]int, error) {
+	if isSharded(fileName) {
+		return readShards(fileName)
+	}
+	return readBackedUp(fileName)
+}
+
+// With -sharded, counts files are split up into a directory named after the
+// file, with a file for each possible first byte of the names in it, named
+// by its value in hex.
+
+// isSharded returns whether a counts file is split up. Once it has been,
+// it stays that way, even without -sharded, so that the history isn't split
+// between the two.
+func isSharded(fileName string) bool {
+	if *sharded {
+		return true
+	}
+	info, err := os.Stat(fileName + ".d")
+	return err == nil && info.IsDir()
+}
+
+func shardName(fileName, name string) string {
+	if name == "" {
+		// Shouldn't happen, but keep it with the control characters.
+		return fileName + ".d/00"
+	}
+	return fmt.Sprintf("%s.d/%02x", fileName, name[0])
+}
+
+func readShards(fileName string) (map[string]int, error) {
+	shards, err := filepath.Glob(fileName + ".d/[0-9a-f][0-9a-f]")
+	if err != nil {
+		return nil, err
+	}
+	if len(shards) == 0 {
+		// Not split up yet.
+		return readBackedUp(fileName)
+	}
+	counts := make(map[string]int)
+	var errs []error
+	for _, shard := range shards {
+		shardCounts, err := readBackedUp(shard)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		maps.Copy(counts, shardCounts)
+	}
+	return counts, errors.Join(errs...)
+}
+
+// readBackedUp reads a counts file, falling back to its backup if it's empty
+// or corrupted.
+func readBackedUp(fileName string) (map[string]int, error) {
+	counts, err := readFreqFile(fileName)
+	if err == nil && len(counts) > 0 || errors.Is(err, os.ErrNotExist) {
+		return counts, err
+	}
+	backup, backupErr := readFreqFile(fileName + ".bak")
+	if backupErr != nil || len(backup) == 0 {
+		return counts, err
+	}
+	if err == nil {
+		err = fmt.Errorf("%s is empty", fileName)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s, recovered from %s.bak\n", err, fileName)
+	return backup, nil
+}
+
+func readFreqFile(fileName string) (map[string]int, error) {
+	countsFile, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer countsFile.Close()
+	counts := make(map[string]int)
+	lineNum := 0
+	scanner := bufio.NewScanner(countsFile)
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		i := strings.LastIndex(line, "\t")
+		if i < 0 {
+			return counts, fmt.Errorf("%s:%d invalid syntax", fileName, lineNum)
+		}
+		name, countStr := line[:i], line[i+1:]
+		count, err := strconv.Atoi(countStr)
+		if err != nil {
+			return counts, fmt.Errorf("%s:%d invalid syntax: %s", fileName, lineNum, err)
+		}
+		if name == "" {
+			// Nothing can be launched by an empty name.
+			continue
+		}
+		counts[name] = count
+	}
+	return counts, scanner.Err()
+}
+
+// byValue orders names by decreasing value in m, then alphabetically.
+func byValue(m map[string]int) func(x, y string) int {
+	return func(x, y string) int {
+		if n := cmp.Compare(m[y], m[x]); n != 0 {
+			return n
+		}
+		return strings.Compare(x, y)
+	}
+}
+
+// countsOrder returns the order of the lines in the counts file.
+func countsOrder(freq, times map[string]int) (func(x, y string) int, error) {
+	switch *storeOrder {
+	case "count":
+		return byValue(freq), nil
+	case "name":
+		return strings.Compare, nil
+	case "recent":
+		return byValue(times), nil
+	case "length":
+		return func(x, y string) int {
+			if n := cmp.Compare(len(x), len(y)); n != 0 {
+				return n
+			}
+			return strings.Compare(x, y)
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid store order %q", *storeOrder)
+}
+
+// writeFreq replaces a counts file with freq. Names are written in the
+// order given by compare. With -sharded, only the parts holding the changed
+// names are rewritten; if none are given, everything is.
+func writeFreq(fileName string, freq map[string]int, compare func(x, y string) int, changed ...string) error {
+	if !isSharded(fileName) {
+		return writeFreqFile(fileName, freq, compare)
+	}
+	dir := fileName + ".d"
+	_, err := os.Stat(dir)
+	migrating := errors.Is(err, os.ErrNotExist)
+	if migrating || len(changed) == 0 {
+		changed = changed[:0]
+		for name := range freq {
+			changed = append(changed, name)
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("write %s: %s", fileName, err)
+	}
+	shards := make(map[string]map[string]int)
+	for _, name := range changed {
+		shards[shardName(fileName, name)] = make(map[string]int)
+	}
+	for name, v := range freq {
+		if shard, ok := shards[shardName(fileName, name)]; ok {
+			shard[name] = v
+		}
+	}
+	for shardFileName, shard := range shards {
+		if err := writeFreqFile(shardFileName, shard, compare); err != nil {
+			return err
+		}
+	}
+	if migrating {
+		// Everything is in the shards now.
+		for _, f := range []string{fileName, fileName + ".bak"} {
+			if err := os.Remove(f); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeFreqFile(fileName string, freq map[string]int, compare func(x, y string) int) (err error) {
+	keys := make([]string, 0, len(freq))
+	for k := range freq {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, compare)
+	tempFile, err := os.CreateTemp(dataDir, "")
+	if err != nil {
+		return fmt.Errorf("write %s: %s", fileName, err)
+	}
+	defer func() {
+		if err != nil {
+			tempFile.Close()
+			os.Remove(tempFile.Name())
+		}
+	}()
+	w := bufio.NewWriter(tempFile)
+	for _, k := range keys {
+		if _, err := fmt.Fprintf(w, "%s\t%d\n", k, freq[k]); err != nil {
+			return fmt.Errorf("write %s: %s", fileName, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write %s: %s", fileName, err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("write %s: %s", fileName, err)
+	}
+	// Keep the previous version as a backup, unless there's nothing left
+	// to back up, in which case a stale backup would be resurrected by
+	// readFreq.
+	backup := fileName + ".bak"
+	if err := os.Remove(backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("write %s: %s", fileName, err)
+	}
+	if len(freq) > 0 {
+		if err := os.Link(fileName, backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+			// Not every filesystem has hard links. The backup is only
+			// a precaution, so failing to make it doesn't stop the
+			// save.
+			if err := copyFile(fileName, backup); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: back up %s: %s\n", fileName, err)
+			}
+		}
+	}
+	if err := os.Rename(tempFile.Name(), fileName); err != nil {
+		return fmt.Errorf("write %s: %s", fileName, err)
+	}
+	return nil
+}
+
+// copyFile copies the file src to dst.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// refreshFreq replaces the contents of freq with those of the file, if it can
+// be read.
+func refreshFreq(freq map[string]int, fileName string) {
+	if latest, err := readFreq(fileName); err == nil {
+		clear(freq)
+		maps.Copy(freq, latest)
+	}
+}
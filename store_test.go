@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"strings"
+	"testing"
+)
+
+// setTestDataDir moves the data directory somewhere new for the rest of the
+// test.
+func setTestDataDir(t *testing.T) {
+	t.Helper()
+	oldDataDir := dataDir
+	setDataDir(t.TempDir())
+	t.Cleanup(func() { setDataDir(oldDataDir) })
+}
+
+// checkCounts checks that a counts file reads back as want.
+func checkCounts(t *testing.T, fileName string, want map[string]int) {
+	t.Helper()
+	got, err := readFreq(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("readFreq(%s) = %v, want %v", fileName, got, want)
+	}
+}
+
+func TestShardedMigration(t *testing.T) {
+	setTestDataDir(t)
+	freq := map[string]int{"aa": 1, "ab": 2, "bb": 3}
+	if err := writeFreq(countsFileName, freq, strings.Compare); err != nil {
+		t.Fatal(err)
+	}
+	setTestFlag(t, "sharded", "true")
+	checkCounts(t, countsFileName, freq)
+	freq["aa"]++
+	if err := writeFreq(countsFileName, freq, strings.Compare, "aa"); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{countsFileName, countsFileName + ".bak"} {
+		if _, err := os.Stat(f); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s left behind after splitting up the counts: %v", f, err)
+		}
+	}
+	for _, shard := range []string{"61", "62"} {
+		if _, err := os.Stat(countsFileName + ".d/" + shard); err != nil {
+			t.Error(err)
+		}
+	}
+	checkCounts(t, countsFileName, freq)
+}
+
+func TestShardedWritesChangedShard(t *testing.T) {
+	setTestDataDir(t)
+	setTestFlag(t, "sharded", "true")
+	if err := writeFreq(countsFileName, map[string]int{"aa": 1, "bb": 1}, strings.Compare); err != nil {
+		t.Fatal(err)
+	}
+	// Only the shard holding aa is rewritten, so the change to bb is lost.
+	if err := writeFreq(countsFileName, map[string]int{"aa": 2, "bb": 5}, strings.Compare, "aa"); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts(t, countsFileName, map[string]int{"aa": 2, "bb": 1})
+	// The backup of the old shard isn't read as a shard.
+	if _, err := os.Stat(countsFileName + ".d/61.bak"); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts(t, countsFileName+".d/61.bak", map[string]int{"aa": 1})
+}
+
+func TestShardedWithoutFlag(t *testing.T) {
+	setTestDataDir(t)
+	setTestFlag(t, "sharded", "true")
+	if err := writeFreq(countsFileName, map[string]int{"aa": 1, "bb": 1}, strings.Compare); err != nil {
+		t.Fatal(err)
+	}
+	setTestFlag(t, "sharded", "false")
+	checkCounts(t, countsFileName, map[string]int{"aa": 1, "bb": 1})
+	if err := writeFreq(countsFileName, map[string]int{"aa": 1, "bb": 2}, strings.Compare, "bb"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(countsFileName); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%s written next to its shards: %v", countsFileName, err)
+	}
+	setTestFlag(t, "sharded", "true")
+	checkCounts(t, countsFileName, map[string]int{"aa": 1, "bb": 2})
+}
+
+func TestBackupRecovery(t *testing.T) {
+	first := map[string]int{"foot": 1}
+	second := map[string]int{"foot": 2, "firefox": 1}
+	for _, broken := range []string{"", "foot\tmany\n", "no tab\n"} {
+		setTestDataDir(t)
+		for _, freq := range []map[string]int{first, second} {
+			if err := writeFreq(countsFileName, freq, strings.Compare); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.WriteFile(countsFileName, []byte(broken), 0644); err != nil {
+			t.Fatal(err)
+		}
+		stderr := captureStderr(t, func() { checkCounts(t, countsFileName, first) })
+		if !strings.Contains(stderr, "recovered from") {
+			t.Errorf("counts file %q recovered without a warning", broken)
+		}
+	}
+}
+
+func TestEmptyWriteRemovesBackup(t *testing.T) {
+	setTestDataDir(t)
+	for _, freq := range []map[string]int{{"foot": 1}, {"foot": 2}, {}} {
+		if err := writeFreq(countsFileName, freq, strings.Compare); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(countsFileName + ".bak"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stale backup left after saving no counts: %v", err)
+	}
+	checkCounts(t, countsFileName, map[string]int{})
+}